@@ -0,0 +1,39 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetchers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// NewS3Fetcher returns an HTTPFetcher pointed at a virtual-hosted-style S3
+// object URL. Buckets that aren't public need client.Transport set to a
+// RoundTripper that signs requests (e.g. the AWS SDK's v4.Signer); this
+// package stays free of an SDK dependency by accepting that client as-is.
+func NewS3Fetcher(bucket, key, region string, client *http.Client) *HTTPFetcher {
+	host := bucket + ".s3.amazonaws.com"
+	if region != "" && region != "us-east-1" {
+		host = fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region)
+	}
+	return &HTTPFetcher{URL: fmt.Sprintf("https://%s/%s", host, key), Client: client}
+}
+
+// NewGCSFetcher returns an HTTPFetcher pointed at a GCS object URL.
+// Private objects need client.Transport set to attach an OAuth2 bearer
+// token, the same way NewS3Fetcher delegates signing for private buckets.
+func NewGCSFetcher(bucket, object string, client *http.Client) *HTTPFetcher {
+	return &HTTPFetcher{URL: fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, object), Client: client}
+}
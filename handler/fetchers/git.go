@@ -0,0 +1,78 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetchers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"go.bourbon.stream/go-vanityurls-apex/handler"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// GitFetcher reads vanity.yaml out of a git repo checked out (and kept up
+// to date with a pull) in Dir, the way x/website serves its content
+// straight from a checked-out source tree instead of a packaged file.
+type GitFetcher struct {
+	Repo   string
+	Branch string // defaults to the repo's default branch
+	Dir    string
+	Path   string // path to the config file within the repo; defaults to "vanity.yaml"
+
+	mu sync.Mutex
+}
+
+// Fetch implements handler.ConfigFetcher.
+func (f *GitFetcher) Fetch() (*handler.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := f.Path
+	if path == "" {
+		path = "vanity.yaml"
+	}
+
+	if _, err := os.Stat(filepath.Join(f.Dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone"}
+		if f.Branch != "" {
+			args = append(args, "--branch", f.Branch)
+		}
+		args = append(args, f.Repo, f.Dir)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("git clone %s: %v: %s", f.Repo, err, out)
+		}
+	} else if err == nil {
+		if out, err := exec.Command("git", "-C", f.Dir, "pull", "--ff-only").CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("git pull %s: %v: %s", f.Repo, err, out)
+		}
+	} else {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(f.Dir, path))
+	if err != nil {
+		return nil, err
+	}
+
+	var config *handler.Config
+	if err := yaml.Unmarshal(body, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetchers
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// initUpstreamRepo creates a git repo under t.TempDir() containing a
+// vanity.yaml at the repo root, committed so it can be cloned locally
+// without network access.
+func initUpstreamRepo(t *testing.T, configPath, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "test@example.com")
+	run("config", "user.name", "test")
+
+	full := filepath.Join(dir, configPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+	return dir
+}
+
+func TestGitFetcherClonesThenPulls(t *testing.T) {
+	upstream := initUpstreamRepo(t, "vanity.yaml", "host: example.com\n")
+	f := &GitFetcher{Repo: upstream, Dir: filepath.Join(t.TempDir(), "checkout")}
+
+	config, err := f.Fetch()
+	if err != nil {
+		t.Fatalf("first Fetch() (clone) error = %v", err)
+	}
+	if config.Host != "example.com" {
+		t.Errorf("config.Host = %q, want example.com", config.Host)
+	}
+
+	config, err = f.Fetch()
+	if err != nil {
+		t.Fatalf("second Fetch() (pull) error = %v", err)
+	}
+	if config.Host != "example.com" {
+		t.Errorf("config.Host = %q, want example.com", config.Host)
+	}
+}
+
+func TestGitFetcherCustomPath(t *testing.T) {
+	upstream := initUpstreamRepo(t, "config/vanity.yaml", "host: custom.example.com\n")
+	f := &GitFetcher{Repo: upstream, Dir: filepath.Join(t.TempDir(), "checkout"), Path: "config/vanity.yaml"}
+
+	config, err := f.Fetch()
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if config.Host != "custom.example.com" {
+		t.Errorf("config.Host = %q, want custom.example.com", config.Host)
+	}
+}
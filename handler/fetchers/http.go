@@ -0,0 +1,102 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fetchers provides ready-made handler.ConfigFetcher
+// implementations beyond the plain local-file fetcher in main.go, for
+// deployments where vanity.yaml doesn't live inside the container image.
+package fetchers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"go.bourbon.stream/go-vanityurls-apex/handler"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HTTPFetcher fetches the config from a URL, sending If-None-Match and
+// If-Modified-Since on subsequent calls so an unchanged config doesn't
+// get re-downloaded and re-parsed on every fetch_interval tick.
+type HTTPFetcher struct {
+	URL string
+
+	// Client is used to make the request; defaults to http.DefaultClient.
+	// For S3/GCS objects behind auth, set Client.Transport to a
+	// RoundTripper that signs the request.
+	Client *http.Client
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	lastConfig   *handler.Config
+}
+
+// Fetch implements handler.ConfigFetcher.
+func (f *HTTPFetcher) Fetch() (*handler.Config, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	f.mu.Unlock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if f.lastConfig == nil {
+			return nil, fmt.Errorf("fetchers: %s returned 304 with no config cached yet", f.URL)
+		}
+		return f.lastConfig, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetchers: %s returned %s", f.URL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var config *handler.Config
+	if err := yaml.Unmarshal(body, &config); err != nil {
+		return nil, err
+	}
+
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	f.lastConfig = config
+
+	return config, nil
+}
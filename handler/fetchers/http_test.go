@@ -0,0 +1,96 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetchers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPFetcherFetchesAndCachesCaching(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("host: example.com\n"))
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{URL: srv.URL}
+	config, err := f.Fetch()
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if config.Host != "example.com" {
+		t.Errorf("config.Host = %q, want example.com", config.Host)
+	}
+	if f.etag != `"abc"` {
+		t.Errorf("f.etag = %q, want \"abc\"", f.etag)
+	}
+}
+
+func TestHTTPFetcherNotModifiedReturnsCachedConfig(t *testing.T) {
+	first := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if first {
+			first = false
+			w.Header().Set("ETag", `"abc"`)
+			w.Write([]byte("host: example.com\n"))
+			return
+		}
+		if got := r.Header.Get("If-None-Match"); got != `"abc"` {
+			t.Errorf("If-None-Match = %q, want \"abc\"", got)
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{URL: srv.URL}
+	if _, err := f.Fetch(); err != nil {
+		t.Fatalf("first Fetch() error = %v", err)
+	}
+
+	config, err := f.Fetch()
+	if err != nil {
+		t.Fatalf("second Fetch() error = %v", err)
+	}
+	if config.Host != "example.com" {
+		t.Errorf("config.Host = %q, want example.com", config.Host)
+	}
+}
+
+func TestHTTPFetcherNotModifiedWithNoCacheIsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{URL: srv.URL}
+	if _, err := f.Fetch(); err == nil {
+		t.Fatal("Fetch() error = nil, want error for an uncached 304")
+	}
+}
+
+func TestHTTPFetcherNon200IsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{URL: srv.URL}
+	if _, err := f.Fetch(); err == nil {
+		t.Fatal("Fetch() error = nil, want error for a 500 response")
+	}
+}
@@ -18,6 +18,7 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -38,13 +39,17 @@ type ConfigFetcher interface {
 
 // Config is the data needed to set up the Handler
 type Config struct {
-	Host          string `yaml:"host,omitempty"`
-	FetchInterval *int   `yaml:"fetch_interval,omitempty"`
-	CacheAge      *int   `yaml:"cache_max_age,omitempty"`
+	Host          string               `yaml:"host,omitempty"`
+	FetchInterval *int                 `yaml:"fetch_interval,omitempty"`
+	CacheAge      *int                 `yaml:"cache_max_age,omitempty"`
+	Proxy         *ProxyConfig         `yaml:"proxy,omitempty"`
+	HostTemplates []CustomHostTemplate `yaml:"host_templates,omitempty"`
 	Paths         map[string]struct {
-		Repo    string `yaml:"repo,omitempty"`
-		Display string `yaml:"display,omitempty"`
-		VCS     string `yaml:"vcs,omitempty"`
+		Repo         string `yaml:"repo,omitempty"`
+		Display      string `yaml:"display,omitempty"`
+		VCS          string `yaml:"vcs,omitempty"`
+		Branch       string `yaml:"branch,omitempty"`
+		HostTemplate string `yaml:"host_template,omitempty"`
 	} `yaml:"paths,omitempty"`
 }
 
@@ -55,6 +60,17 @@ type Handler struct {
 	host         string
 	cacheControl string
 	paths        pathConfigSet
+
+	proxyEnabled       bool
+	proxyFetchInterval int
+	repoCache          *repoCache
+
+	fetcher ConfigFetcher
+	metrics *handlerMetrics
+
+	healthMu                 sync.Mutex
+	lastFetchSuccess         time.Time
+	consecutiveFetchFailures int
 }
 
 type pathConfig struct {
@@ -62,10 +78,11 @@ type pathConfig struct {
 	repo    string
 	display string
 	vcs     string
+	branch  string
 }
 
 // NewHandler creates a new handler
-func NewHandler(fetcher ConfigFetcher) (*Handler, error) {
+func NewHandler(fetcher ConfigFetcher, opts ...Option) (*Handler, error) {
 	fetchInterval := 86400
 
 	config, err := fetcher.Fetch()
@@ -77,26 +94,23 @@ func NewHandler(fetcher ConfigFetcher) (*Handler, error) {
 		fetchInterval = *config.FetchInterval
 	}
 
-	h := Handler{}
+	h := Handler{proxyFetchInterval: fetchInterval, fetcher: fetcher}
+	for _, opt := range opts {
+		opt(&h)
+	}
 
 	err = h.configure(config)
 	if err != nil {
 		return nil, err
 	}
+	h.recordFetch(true)
 
 	go func() {
-		var err error
-
 		for {
 			time.Sleep(time.Duration(fetchInterval) * time.Second)
 
-			config, err = fetcher.Fetch()
-			if err != nil {
+			if err := h.Reload(context.Background()); err != nil {
 				log.Println(err)
-			} else {
-				if err := h.configure(config); err != nil {
-					log.Println(err)
-				}
 			}
 		}
 	}()
@@ -104,67 +118,172 @@ func NewHandler(fetcher ConfigFetcher) (*Handler, error) {
 	return &h, nil
 }
 
-func (h *Handler) configure(c *Config) error {
+// Reload fetches the latest config from the ConfigFetcher passed to
+// NewHandler, fully validates it, and only then swaps it in under h.mu --
+// on any error the previous, already-serving config is left untouched.
+// Callers can invoke it directly on SIGHUP or from an admin endpoint to
+// force an immediate reload instead of waiting for fetch_interval. ctx is
+// accepted for forward compatibility with fetchers that support
+// cancellation; ConfigFetcher.Fetch itself doesn't take one yet.
+func (h *Handler) Reload(ctx context.Context) error {
+	config, err := h.fetcher.Fetch()
+	if err != nil {
+		h.recordFetch(false)
+		return err
+	}
+	h.recordFetch(true)
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	before := h.paths
+	h.mu.Unlock()
+
+	if err := h.configure(config); err != nil {
+		return err
+	}
+
+	logPathDiff(before, h.paths)
+	return nil
+}
+
+// logPathDiff emits one structured log line describing which vanity paths
+// were added, removed, or changed (repo/vcs/display/branch) by a reload.
+func logPathDiff(before, after pathConfigSet) {
+	beforeByPath := make(map[string]pathConfig, len(before))
+	for _, pc := range before {
+		beforeByPath[pc.path] = pc
+	}
+	afterByPath := make(map[string]pathConfig, len(after))
+	for _, pc := range after {
+		afterByPath[pc.path] = pc
+	}
+
+	var added, removed, changed []string
+	for path, pc := range afterByPath {
+		old, ok := beforeByPath[path]
+		if !ok {
+			added = append(added, path)
+		} else if old != pc {
+			changed = append(changed, path)
+		}
+	}
+	for path := range beforeByPath {
+		if _, ok := afterByPath[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 && len(changed) == 0 {
+		return
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	log.Printf("config reloaded: added=%v removed=%v changed=%v", added, removed, changed)
+}
 
+// configure validates c completely into local values and only swaps them
+// into h -- under h.mu -- once the whole config is known good. That way a
+// bad reload (e.g. an unresolvable VCS partway through c.Paths) leaves the
+// previous, already-serving config untouched instead of replacing it with
+// a partial result.
+func (h *Handler) configure(c *Config) error {
 	cacheAge := 86400
 	if c.CacheAge != nil {
 		if *c.CacheAge < 0 {
 			return errors.New("cache_max_age is negative")
 		}
-		if *c.CacheAge >= 0 {
-			cacheAge = *c.CacheAge
-		}
+		cacheAge = *c.CacheAge
 	}
 
-	h.host = c.Host
-	h.cacheControl = fmt.Sprintf("public, max-age=%d", cacheAge)
-	h.paths = make(pathConfigSet, 0)
-
+	newPaths := make(pathConfigSet, 0, len(c.Paths))
 	for path, e := range c.Paths {
+		branch := e.Branch
+		if branch == "" {
+			branch = "master"
+		}
 		pc := pathConfig{
 			path:    strings.TrimSuffix(path, "/"),
 			repo:    e.Repo,
 			display: e.Display,
 			vcs:     e.VCS,
+			branch:  branch,
+		}
+
+		var tmpl *resolvedHostTemplate
+		if e.HostTemplate != "" {
+			var err error
+			tmpl, err = findHostTemplate(c.HostTemplates, e.HostTemplate)
+			if err != nil {
+				return fmt.Errorf("configuration for %v: %v", path, err)
+			}
+		} else {
+			tmpl = matchHostTemplate(c.HostTemplates, e.Repo)
 		}
+
 		switch {
 		case e.Display != "":
 			// Already filled in.
-		case strings.HasPrefix(e.Repo, "https://github.com/"):
-			pc.display = fmt.Sprintf("%v %v/tree/master{/dir} %v/blob/master{/dir}/{file}#L{line}", e.Repo, e.Repo, e.Repo)
-		case strings.HasPrefix(e.Repo, "https://bitbucket.org"):
-			pc.display = fmt.Sprintf("%v %v/src/default{/dir} %v/src/default{/dir}/{file}#{file}-{line}", e.Repo, e.Repo, e.Repo)
+		case tmpl != nil:
+			pc.display = tmpl.display(e.Repo, branch)
 		}
+
 		switch {
 		case e.VCS != "":
 			// Already filled in.
-			if e.VCS != "bzr" && e.VCS != "git" && e.VCS != "hg" && e.VCS != "svn" {
+			if !validVCS(e.VCS) {
 				return fmt.Errorf("configuration for %v: unknown VCS %s", path, e.VCS)
 			}
-		case strings.HasPrefix(e.Repo, "https://github.com/"):
-			pc.vcs = "git"
+		case tmpl != nil:
+			pc.vcs = tmpl.vcs
 		default:
 			return fmt.Errorf("configuration for %v: cannot infer VCS from %s", path, e.Repo)
 		}
-		h.paths = append(h.paths, pc)
+		newPaths = append(newPaths, pc)
 	}
+	sort.Sort(newPaths)
+
+	proxyEnabled := c.Proxy != nil && c.Proxy.Enabled
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	sort.Sort(h.paths)
+	h.host = c.Host
+	h.cacheControl = fmt.Sprintf("public, max-age=%d", cacheAge)
+	h.paths = newPaths
+
+	h.proxyEnabled = proxyEnabled
+	if proxyEnabled && h.repoCache == nil {
+		h.repoCache = newRepoCache(c.Proxy.CacheDir)
+	}
 
 	return nil
 }
 
+func validVCS(vcs string) bool {
+	switch vcs {
+	case "bzr", "fossil", "git", "hg", "svn":
+		return true
+	}
+	return false
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	current := r.URL.Path
 	pc, subpath := h.paths.find(current)
 	if pc == nil && current == "/" {
 		h.serveIndex(w, r)
+		h.observe(r, nil, "", "index", start)
 		return
 	}
 	if pc == nil {
 		http.NotFound(w, r)
+		h.observe(r, nil, "", "notfound", start)
+		return
+	}
+
+	if h.proxyEnabled && h.serveProxy(w, r, pc, subpath) {
+		h.observe(r, pc, subpath, "proxy", start)
 		return
 	}
 
@@ -183,7 +302,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		VCS:     pc.vcs,
 	}); err != nil {
 		http.Error(w, "cannot render the page", http.StatusInternalServerError)
+		if h.metrics != nil {
+			h.metrics.templateErrors.Inc()
+		}
+		h.observe(r, pc, subpath, "error", start)
+		return
 	}
+	h.observe(r, pc, subpath, "match", start)
 }
 
 func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
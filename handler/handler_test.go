@@ -0,0 +1,85 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import "testing"
+
+func validConfig() *Config {
+	return &Config{
+		Host: "example.com",
+		Paths: map[string]struct {
+			Repo         string `yaml:"repo,omitempty"`
+			Display      string `yaml:"display,omitempty"`
+			VCS          string `yaml:"vcs,omitempty"`
+			Branch       string `yaml:"branch,omitempty"`
+			HostTemplate string `yaml:"host_template,omitempty"`
+		}{
+			"/foo": {Repo: "https://github.com/example/foo"},
+		},
+	}
+}
+
+func TestConfigureValid(t *testing.T) {
+	h := &Handler{}
+	if err := h.configure(validConfig()); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	if len(h.paths) != 1 || h.paths[0].path != "/foo" {
+		t.Fatalf("h.paths = %+v, want a single /foo entry", h.paths)
+	}
+	if h.paths[0].vcs != "git" {
+		t.Errorf("h.paths[0].vcs = %q, want git", h.paths[0].vcs)
+	}
+}
+
+func TestConfigureRejectsNegativeCacheAge(t *testing.T) {
+	h := &Handler{}
+	neg := -1
+	c := validConfig()
+	c.CacheAge = &neg
+	if err := h.configure(c); err == nil {
+		t.Fatal("configure() error = nil, want error for negative cache_max_age")
+	}
+}
+
+// A reload that fails partway through must not mutate the handler's
+// already-serving config -- see the doc comment on configure.
+func TestConfigureLeavesPreviousConfigOnError(t *testing.T) {
+	h := &Handler{}
+	if err := h.configure(validConfig()); err != nil {
+		t.Fatalf("initial configure() error = %v", err)
+	}
+	before := h.paths
+
+	bad := &Config{
+		Paths: map[string]struct {
+			Repo         string `yaml:"repo,omitempty"`
+			Display      string `yaml:"display,omitempty"`
+			VCS          string `yaml:"vcs,omitempty"`
+			Branch       string `yaml:"branch,omitempty"`
+			HostTemplate string `yaml:"host_template,omitempty"`
+		}{
+			"/foo": {Repo: "https://github.com/example/foo"},
+			"/bar": {Repo: "https://unknown-forge.example/bar"}, // cannot infer VCS
+		},
+	}
+	if err := h.configure(bad); err == nil {
+		t.Fatal("configure(bad) error = nil, want error")
+	}
+
+	if len(h.paths) != len(before) || h.paths[0] != before[0] {
+		t.Errorf("h.paths changed after a failed reload: got %+v, want %+v", h.paths, before)
+	}
+}
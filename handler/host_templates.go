@@ -0,0 +1,150 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HostTemplate knows how to fill in the go-source display string (and, for
+// the auto-detected ones, the vcs) for repos hosted on a particular forge.
+// Match is nil for forges that can't be recognized from the repo URL alone
+// (e.g. self-hosted Gitea/Gogs instances); those must be selected with the
+// per-path host_template field instead.
+type HostTemplate struct {
+	Name    string
+	Match   func(repo string) bool
+	VCS     string
+	Display func(repo, branch string) string
+}
+
+// CustomHostTemplate is a host_templates entry in vanity.yaml, letting
+// operators teach the handler about a self-hosted forge that isn't one of
+// the built-ins below. Display may reference {repo} and {branch}. Name is
+// optional and lets a path opt into this template explicitly via its
+// host_template field, for the (self-hosted, no fixed domain) forges that
+// Prefix alone can't auto-detect.
+type CustomHostTemplate struct {
+	Name    string `yaml:"name,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty"`
+	VCS     string `yaml:"vcs,omitempty"`
+	Display string `yaml:"display,omitempty"`
+}
+
+// resolve builds a resolvedHostTemplate from t, expanding {repo} and
+// {branch} placeholders in Display.
+func (t CustomHostTemplate) resolve() *resolvedHostTemplate {
+	display := t.Display
+	return &resolvedHostTemplate{
+		vcs: t.VCS,
+		display: func(repo, branch string) string {
+			r := strings.NewReplacer("{repo}", repo, "{branch}", branch)
+			return r.Replace(display)
+		},
+	}
+}
+
+func prefixMatch(prefix string) func(string) bool {
+	return func(repo string) bool { return strings.HasPrefix(repo, prefix) }
+}
+
+func githubDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/tree/%v{/dir} %v/blob/%v{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+func bitbucketDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/src/%v{/dir} %v/src/%v{/dir}/{file}#{file}-{line}", repo, repo, branch, repo, branch)
+}
+
+func gitlabDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/-/tree/%v{/dir} %v/-/blob/%v{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+func giteaDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/src/branch/%v{/dir} %v/src/branch/%v{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+func gogsDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/src/%v{/dir} %v/src/%v{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+func sourcehutDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/tree/%v/item{/dir} %v/tree/%v/item{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+func cgitDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/tree{/dir}?h=%v %v/tree{/dir}/{file}?h=%v#n{line}", repo, repo, branch, repo, branch)
+}
+
+func fossilDisplay(repo, branch string) string {
+	return fmt.Sprintf("%v %v/dir?ci=%v{/dir} %v/doc/%v{/dir}/{file}#L{line}", repo, repo, branch, repo, branch)
+}
+
+// builtinHostTemplates is checked, in order, by matchHostTemplate. github
+// and bitbucket are the two cases configure already special-cased; gitlab
+// and sourcehut can also be recognized from their fixed domain. Gitea,
+// Gogs, cgit and Fossil are commonly self-hosted under arbitrary domains,
+// so they have no Match and must be named explicitly via host_template.
+var builtinHostTemplates = []HostTemplate{
+	{Name: "github", Match: prefixMatch("https://github.com/"), VCS: "git", Display: githubDisplay},
+	{Name: "bitbucket", Match: prefixMatch("https://bitbucket.org"), VCS: "git", Display: bitbucketDisplay},
+	{Name: "gitlab", Match: prefixMatch("https://gitlab.com/"), VCS: "git", Display: gitlabDisplay},
+	{Name: "sourcehut", Match: prefixMatch("https://git.sr.ht/"), VCS: "git", Display: sourcehutDisplay},
+	{Name: "gitea", VCS: "git", Display: giteaDisplay},
+	{Name: "gogs", VCS: "git", Display: gogsDisplay},
+	{Name: "cgit", VCS: "git", Display: cgitDisplay},
+	{Name: "fossil", VCS: "fossil", Display: fossilDisplay},
+}
+
+// resolvedHostTemplate mirrors HostTemplate but with a custom template's
+// fields already normalized so configure doesn't need to special-case it.
+type resolvedHostTemplate struct {
+	vcs     string
+	display func(repo, branch string) string
+}
+
+// findHostTemplate looks up a host template by the name given in a path's
+// host_template field, checking custom templates (by Name) before the
+// built-ins (by Name).
+func findHostTemplate(custom []CustomHostTemplate, name string) (*resolvedHostTemplate, error) {
+	for _, t := range custom {
+		if t.Name == name {
+			return t.resolve(), nil
+		}
+	}
+	for _, t := range builtinHostTemplates {
+		if t.Name == name {
+			return &resolvedHostTemplate{vcs: t.VCS, display: t.Display}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown host_template %q", name)
+}
+
+// matchHostTemplate finds the first custom or built-in template whose
+// Match recognizes repo, or nil if none applies.
+func matchHostTemplate(custom []CustomHostTemplate, repo string) *resolvedHostTemplate {
+	for _, t := range custom {
+		if t.Prefix != "" && strings.HasPrefix(repo, t.Prefix) {
+			return t.resolve()
+		}
+	}
+	for _, t := range builtinHostTemplates {
+		if t.Match != nil && t.Match(repo) {
+			return &resolvedHostTemplate{vcs: t.VCS, display: t.Display}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import "testing"
+
+func TestMatchHostTemplateBuiltins(t *testing.T) {
+	tests := []struct {
+		repo    string
+		wantVCS string
+	}{
+		{"https://github.com/chiefy/go-vanityurls-apex", "git"},
+		{"https://gitlab.com/chiefy/go-vanityurls-apex", "git"},
+		{"https://git.sr.ht/~chiefy/go-vanityurls-apex", "git"},
+		{"https://example.com/unknown/forge", ""},
+	}
+	for _, tt := range tests {
+		tmpl := matchHostTemplate(nil, tt.repo)
+		if tt.wantVCS == "" {
+			if tmpl != nil {
+				t.Errorf("matchHostTemplate(nil, %q) = %+v, want nil", tt.repo, tmpl)
+			}
+			continue
+		}
+		if tmpl == nil {
+			t.Fatalf("matchHostTemplate(nil, %q) = nil, want vcs %q", tt.repo, tt.wantVCS)
+		}
+		if tmpl.vcs != tt.wantVCS {
+			t.Errorf("matchHostTemplate(nil, %q).vcs = %q, want %q", tt.repo, tmpl.vcs, tt.wantVCS)
+		}
+	}
+}
+
+func TestMatchHostTemplateCustomPrefixWinsOverBuiltin(t *testing.T) {
+	custom := []CustomHostTemplate{
+		{Prefix: "https://github.com/internal/", VCS: "git", Display: "{repo} {repo}/custom/{branch}"},
+	}
+	tmpl := matchHostTemplate(custom, "https://github.com/internal/tool")
+	if tmpl == nil {
+		t.Fatal("matchHostTemplate returned nil, want custom match")
+	}
+	if got, want := tmpl.display("https://github.com/internal/tool", "main"), "https://github.com/internal/tool https://github.com/internal/tool/custom/main"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+}
+
+func TestFindHostTemplateByName(t *testing.T) {
+	custom := []CustomHostTemplate{
+		{Name: "acme", Prefix: "https://code.acme.example/", VCS: "hg", Display: "{repo} {repo}/src/{branch}{/dir}"},
+	}
+
+	tmpl, err := findHostTemplate(custom, "acme")
+	if err != nil {
+		t.Fatalf("findHostTemplate(custom, \"acme\") error = %v", err)
+	}
+	if tmpl.vcs != "hg" {
+		t.Errorf("vcs = %q, want hg", tmpl.vcs)
+	}
+
+	if _, err := findHostTemplate(custom, "gitea"); err != nil {
+		t.Errorf("findHostTemplate(custom, \"gitea\") error = %v, want built-in match", err)
+	}
+
+	if _, err := findHostTemplate(custom, "does-not-exist"); err == nil {
+		t.Error("findHostTemplate(custom, \"does-not-exist\") succeeded, want error")
+	}
+}
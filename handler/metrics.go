@@ -0,0 +1,159 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// healthFailureThreshold is how many consecutive background config fetch
+// failures it takes before Healthz starts reporting unhealthy.
+const healthFailureThreshold = 3
+
+// Option configures optional Handler behavior at construction time.
+type Option func(*Handler)
+
+// WithMetrics registers Prometheus collectors against reg for total
+// requests, path hit counts, template render errors, and config fetch
+// outcomes.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(h *Handler) {
+		h.metrics = newHandlerMetrics(reg)
+	}
+}
+
+type handlerMetrics struct {
+	requestsTotal    *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	pathHits         *prometheus.CounterVec
+	templateErrors   prometheus.Counter
+	fetchTotal       *prometheus.CounterVec
+	lastFetchSuccess prometheus.Gauge
+}
+
+func newHandlerMetrics(reg prometheus.Registerer) *handlerMetrics {
+	m := &handlerMetrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vanityurls_requests_total",
+			Help: "Total requests served, labeled by result (match, proxy, index, notfound, error).",
+		}, []string{"result"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "vanityurls_request_duration_seconds",
+			Help: "Request handling latency, labeled by result.",
+		}, []string{"result"}),
+		pathHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vanityurls_path_hits_total",
+			Help: "Requests served per configured vanity import path.",
+		}, []string{"path"}),
+		templateErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "vanityurls_template_errors_total",
+			Help: "Failures rendering the go-import/go-source page.",
+		}),
+		fetchTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vanityurls_config_fetch_total",
+			Help: "Config fetch attempts, labeled by outcome (success, failure).",
+		}, []string{"result"}),
+		lastFetchSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "vanityurls_last_fetch_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful config fetch.",
+		}),
+	}
+	reg.MustRegister(m.requestsTotal, m.requestDuration, m.pathHits, m.templateErrors, m.fetchTotal, m.lastFetchSuccess)
+	return m
+}
+
+// observe records one served request: a structured access log line, plus
+// metrics when WithMetrics is in use.
+func (h *Handler) observe(r *http.Request, pc *pathConfig, subpath, result string, start time.Time) {
+	attrs := []any{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("result", result),
+		slog.String("user_agent", r.UserAgent()),
+	}
+	if pc != nil {
+		attrs = append(attrs,
+			slog.String("import_path", pc.path),
+			slog.String("subpath", subpath),
+			slog.String("vcs", pc.vcs),
+		)
+	}
+	slog.Info("vanity request", attrs...)
+
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.requestsTotal.WithLabelValues(result).Inc()
+	h.metrics.requestDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if pc != nil {
+		h.metrics.pathHits.WithLabelValues(pc.path).Inc()
+	}
+}
+
+// recordFetch updates the state Healthz/Ready and the fetch metrics are
+// derived from, following a config fetch attempt.
+func (h *Handler) recordFetch(ok bool) {
+	h.healthMu.Lock()
+	if ok {
+		h.lastFetchSuccess = time.Now()
+		h.consecutiveFetchFailures = 0
+	} else {
+		h.consecutiveFetchFailures++
+	}
+	h.healthMu.Unlock()
+
+	if h.metrics == nil {
+		return
+	}
+	if ok {
+		h.metrics.fetchTotal.WithLabelValues("success").Inc()
+		h.metrics.lastFetchSuccess.Set(float64(time.Now().Unix()))
+	} else {
+		h.metrics.fetchTotal.WithLabelValues("failure").Inc()
+	}
+}
+
+// Healthz reports 200 while the background config fetch loop is healthy,
+// and 503 once it has failed healthFailureThreshold times in a row.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.healthMu.Lock()
+	failures := h.consecutiveFetchFailures
+	h.healthMu.Unlock()
+
+	if failures >= healthFailureThreshold {
+		http.Error(w, "config fetch loop unhealthy", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Ready reports 503 until the handler has loaded a config at least once,
+// then behaves like Healthz.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	h.healthMu.Lock()
+	ready := !h.lastFetchSuccess.IsZero()
+	h.healthMu.Unlock()
+
+	if !ready {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	h.Healthz(w, r)
+}
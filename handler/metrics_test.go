@@ -0,0 +1,66 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyBeforeFirstFetch(t *testing.T) {
+	h := &Handler{}
+
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/-/ready", nil))
+	if w.Code != 503 {
+		t.Errorf("Ready() before any fetch = %d, want 503", w.Code)
+	}
+}
+
+func TestHealthzUnhealthyAfterThreshold(t *testing.T) {
+	h := &Handler{}
+	h.recordFetch(true)
+
+	w := httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest("GET", "/-/healthz", nil))
+	if w.Code != 200 {
+		t.Fatalf("Healthz() after a success = %d, want 200", w.Code)
+	}
+
+	for i := 0; i < healthFailureThreshold; i++ {
+		h.recordFetch(false)
+	}
+
+	w = httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest("GET", "/-/healthz", nil))
+	if w.Code != 503 {
+		t.Errorf("Healthz() after %d failures = %d, want 503", healthFailureThreshold, w.Code)
+	}
+}
+
+func TestRecordFetchResetsFailureCountOnSuccess(t *testing.T) {
+	h := &Handler{}
+	h.recordFetch(true)
+	for i := 0; i < healthFailureThreshold; i++ {
+		h.recordFetch(false)
+	}
+	h.recordFetch(true)
+
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/-/ready", nil))
+	if w.Code != 200 {
+		t.Errorf("Ready() after a success following %d failures = %d, want 200", healthFailureThreshold, w.Code)
+	}
+}
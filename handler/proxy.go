@@ -0,0 +1,458 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyConfig enables the Go module proxy protocol
+// (https://go.dev/ref/mod#goproxy-protocol) for every configured path, so
+// that GOPROXY can point directly at this server instead of
+// clients also needing to reach the upstream host.
+type ProxyConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// CacheDir holds the bare VCS clones used to resolve versions and
+	// assemble module zips. Defaults to "vanity-proxy-cache".
+	CacheDir string `yaml:"cache_dir,omitempty"`
+}
+
+// moduleProxyPath matches the suffix of a Go module proxy request relative
+// to a configured vanity import path, per the GOPROXY protocol.
+var moduleProxyPath = regexp.MustCompile(`^@(latest|v/list|v/([^/]+)\.info|v/([^/]+)\.mod|v/([^/]+)\.zip)$`)
+
+// maxCachedRepos bounds the in-memory version cache so that requesting
+// proxy endpoints for an unbounded number of distinct repos can't grow
+// repoCache.versions forever; the least-recently-fetched entry is evicted
+// once the cache is full. The on-disk bare clones aren't subject to this
+// cap -- they're a disk cache, not a memory one.
+const maxCachedRepos = 256
+
+// repoCache keeps a bare clone per upstream repo on disk plus a bounded
+// in-memory cache of resolved version lists, so repeated proxy requests
+// for the same module don't re-fetch the remote on every call. Cloning
+// and fetching for a given repo is serialized via repoLock so that two
+// concurrent first-time requests for the same uncached module can't race
+// to `git clone` into the same directory.
+type repoCache struct {
+	dir string
+
+	mu       sync.Mutex
+	versions map[string]*cachedVersions
+	locks    map[string]*sync.Mutex
+}
+
+type cachedVersions struct {
+	fetchedAt time.Time
+	versions  []string // semver tags, ascending
+	pseudo    string   // HEAD pseudo-version, set when versions is empty
+}
+
+func newRepoCache(dir string) *repoCache {
+	if dir == "" {
+		dir = "vanity-proxy-cache"
+	}
+	return &repoCache{
+		dir:      dir,
+		versions: make(map[string]*cachedVersions),
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+func (rc *repoCache) clonePath(repo string) string {
+	sum := sha256.Sum256([]byte(repo))
+	return path.Join(rc.dir, hex.EncodeToString(sum[:])+".git")
+}
+
+// repoLock returns the mutex that serializes clone/fetch operations for
+// repo, creating it on first use.
+func (rc *repoCache) repoLock(repo string) *sync.Mutex {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	l, ok := rc.locks[repo]
+	if !ok {
+		l = &sync.Mutex{}
+		rc.locks[repo] = l
+	}
+	return l
+}
+
+// storeVersions records cv for repo, evicting the least-recently-fetched
+// entry first if the cache is at maxCachedRepos.
+func (rc *repoCache) storeVersions(repo string, cv *cachedVersions) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.versions[repo] = cv
+	if len(rc.versions) <= maxCachedRepos {
+		return
+	}
+	var oldestRepo string
+	var oldest time.Time
+	for r, v := range rc.versions {
+		if oldestRepo == "" || v.fetchedAt.Before(oldest) {
+			oldestRepo, oldest = r, v.fetchedAt
+		}
+	}
+	delete(rc.versions, oldestRepo)
+}
+
+// ensureClone makes sure a bare, up to date clone of repo exists on disk
+// and returns its path. Only git is supported as a proxy backend today;
+// hg/svn/bzr paths are rejected with ErrProxyVCSUnsupported.
+func (rc *repoCache) ensureClone(pc *pathConfig) (string, error) {
+	if pc.vcs != "git" {
+		return "", ErrProxyVCSUnsupported
+	}
+
+	lock := rc.repoLock(pc.repo)
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir := rc.clonePath(pc.repo)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(rc.dir, 0o755); err != nil {
+			return "", err
+		}
+		cmd := exec.Command("git", "clone", "--bare", pc.repo, dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("git clone %s: %v: %s", pc.repo, err, out)
+		}
+		return dir, nil
+	}
+
+	cmd := exec.Command("git", "--git-dir", dir, "fetch", "--tags", "--force", "origin", "+refs/heads/*:refs/heads/*")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git fetch %s: %v: %s", pc.repo, err, out)
+	}
+	return dir, nil
+}
+
+// pseudoVersion returns a v0.0.0-<timestamp>-<hash> pseudo-version for the
+// default branch HEAD of the clone at dir, for repos with no semver tags.
+func (rc *repoCache) pseudoVersion(dir string) (string, error) {
+	cmd := exec.Command("git", "--git-dir", dir, "log", "-1", "--format=%H %cI")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git log: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("git log: unexpected output %q", out)
+	}
+	hash, commitTime := fields[0], fields[1]
+	t, err := time.Parse(time.RFC3339, commitTime)
+	if err != nil {
+		return "", fmt.Errorf("git log: %v", err)
+	}
+	return fmt.Sprintf("v0.0.0-%s-%s", t.UTC().Format("20060102150405"), hash[:12]), nil
+}
+
+// resolve returns the known semver versions for pc, honoring fetchInterval
+// before re-listing tags from the upstream repo. If the repo has no
+// semver tags, versions is empty and pseudo holds a pseudo-version for
+// HEAD instead, per the GOPROXY protocol's requirement that @latest still
+// succeed for repos that have never cut a release.
+func (rc *repoCache) resolve(pc *pathConfig, fetchInterval time.Duration) (versions []string, pseudo string, err error) {
+	rc.mu.Lock()
+	cached, ok := rc.versions[pc.repo]
+	rc.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < fetchInterval {
+		return cached.versions, cached.pseudo, nil
+	}
+
+	dir, err := rc.ensureClone(pc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cmd := exec.Command("git", "--git-dir", dir, "tag")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("git tag: %v", err)
+	}
+
+	for _, tag := range strings.Fields(string(out)) {
+		if isSemver(tag) {
+			versions = append(versions, tag)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return semverLess(versions[i], versions[j]) })
+
+	if len(versions) == 0 {
+		pseudo, err = rc.pseudoVersion(dir)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rc.storeVersions(pc.repo, &cachedVersions{fetchedAt: time.Now(), versions: versions, pseudo: pseudo})
+
+	return versions, pseudo, nil
+}
+
+// modFile returns the contents of go.mod at rev, or a synthesized one
+// naming importPath if rev exists but predates modules (no go.mod file).
+// Any other git error (e.g. rev doesn't exist) is returned rather than
+// masked, since callers are expected to only pass revs already confirmed
+// to exist by resolve.
+func (rc *repoCache) modFile(dir, rev, importPath string) ([]byte, error) {
+	cmd := exec.Command("git", "--git-dir", dir, "show", rev+":go.mod")
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+	if strings.Contains(string(stderr(err)), "does not exist in") {
+		return []byte(fmt.Sprintf("module %s\n", importPath)), nil
+	}
+	return nil, fmt.Errorf("git show %s:go.mod: %v: %s", rev, err, stderr(err))
+}
+
+// stderr returns the stderr captured by exec.Cmd.Output's *exec.ExitError,
+// or nil if err isn't one.
+func stderr(err error) []byte {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.Stderr
+	}
+	return nil
+}
+
+// zipFile assembles a module zip for rev per the golang.org/x/mod/zip
+// layout: every file lives under "<importPath>@<version>/...".
+func (rc *repoCache) zipFile(dir, rev, importPath, version string) ([]byte, error) {
+	cmd := exec.Command("git", "--git-dir", dir, "archive", "--format=zip", rev)
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git archive: %v", err)
+	}
+
+	src, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	dst := zip.NewWriter(&buf)
+	prefix := fmt.Sprintf("%s@%s/", importPath, version)
+	for _, f := range src.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		w, err := dst.Create(prefix + f.Name)
+		if err != nil {
+			return nil, err
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.Close()
+	}
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ErrProxyVCSUnsupported is returned when the module proxy is asked to
+// resolve a path whose vcs is not "git". Only git repos can be archived
+// into a module zip today.
+var ErrProxyVCSUnsupported = fmt.Errorf("module proxy only supports vcs: git")
+
+// serveProxy answers a single Go module proxy request for pc, where
+// subpath is whatever followed pc.path (e.g. "@v/list" or "@v/v1.2.3.zip").
+func (h *Handler) serveProxy(w http.ResponseWriter, r *http.Request, pc *pathConfig, subpath string) bool {
+	m := moduleProxyPath.FindStringSubmatch(subpath)
+	if m == nil {
+		return false
+	}
+
+	importPath := h.getHost(r) + pc.path
+	fetchInterval := time.Duration(h.proxyFetchInterval) * time.Second
+
+	versions, pseudo, err := h.repoCache.resolve(pc, fetchInterval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return true
+	}
+
+	switch {
+	case subpath == "@v/list":
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		fmt.Fprint(w, strings.Join(versions, "\n"))
+		if len(versions) > 0 {
+			fmt.Fprint(w, "\n")
+		}
+		return true
+
+	case subpath == "@latest":
+		version := latestVersion(versions)
+		if version == "" {
+			version = pseudo
+		}
+		if version == "" {
+			http.NotFound(w, r)
+			return true
+		}
+		h.writeInfo(w, version)
+		return true
+
+	case m[2] != "": // @v/<version>.info
+		version := m[2]
+		if !knownVersion(version, versions, pseudo) {
+			http.NotFound(w, r)
+			return true
+		}
+		h.writeInfo(w, version)
+		return true
+
+	case m[3] != "": // @v/<version>.mod
+		version := m[3]
+		if !knownVersion(version, versions, pseudo) {
+			http.NotFound(w, r)
+			return true
+		}
+		dir, err := h.repoCache.ensureClone(pc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return true
+		}
+		mod, err := h.repoCache.modFile(dir, revForVersion(version), importPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return true
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.Write(mod)
+		return true
+
+	case m[4] != "": // @v/<version>.zip
+		version := m[4]
+		if !knownVersion(version, versions, pseudo) {
+			http.NotFound(w, r)
+			return true
+		}
+		dir, err := h.repoCache.ensureClone(pc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return true
+		}
+		zip, err := h.repoCache.zipFile(dir, revForVersion(version), importPath, version)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zip)
+		return true
+	}
+
+	return false
+}
+
+// knownVersion reports whether version is one of the repo's resolved
+// semver tags, or its pseudo-version, per the GOPROXY protocol's
+// requirement that .info/.mod/.zip 404 for anything else.
+func knownVersion(version string, versions []string, pseudo string) bool {
+	if pseudo != "" && version == pseudo {
+		return true
+	}
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// pseudoVersionRe extracts the commit hash prefix from a pseudo-version
+// string (e.g. "v0.0.0-20210101000000-abcdefabcdef"), which is all that's
+// usable as a git revision -- unlike a tag, the pseudo-version string
+// itself isn't a ref that exists in the repo.
+var pseudoVersionRe = regexp.MustCompile(`^v0\.0\.0-\d{14}-([0-9a-f]{12})$`)
+
+// revForVersion returns the git revision to check out for version: the
+// tag itself for a tagged release, or the embedded commit hash for a
+// pseudo-version.
+func revForVersion(version string) string {
+	if m := pseudoVersionRe.FindStringSubmatch(version); m != nil {
+		return m[1]
+	}
+	return version
+}
+
+func (h *Handler) writeInfo(w http.ResponseWriter, version string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(struct {
+		Version string
+		Time    time.Time
+	}{Version: version, Time: time.Now().UTC()})
+}
+
+func latestVersion(versions []string) string {
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+// isSemver and semverLess implement just enough of semver to sort release
+// tags; build metadata is out of scope. Pseudo-versions for untagged repos
+// are handled separately, by repoCache.pseudoVersion.
+var semverRe = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?$`)
+
+func isSemver(tag string) bool {
+	return semverRe.MatchString(tag)
+}
+
+func semverLess(a, b string) bool {
+	pa, pb := semverRe.FindStringSubmatch(a), semverRe.FindStringSubmatch(b)
+	for i := 1; i <= 3; i++ {
+		if pa[i] != pb[i] {
+			return lessNumeric(pa[i], pb[i])
+		}
+	}
+	// A pre-release version (has pa[4]) sorts before its final release.
+	if (pa[4] == "") != (pb[4] == "") {
+		return pa[4] != ""
+	}
+	return pa[4] < pb[4]
+}
+
+func lessNumeric(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
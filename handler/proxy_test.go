@@ -0,0 +1,153 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIsSemver(t *testing.T) {
+	tests := map[string]bool{
+		"v1.2.3":      true,
+		"v0.0.1":      true,
+		"v1.2.3-rc.1": true,
+		"1.2.3":       false,
+		"v1.2":        false,
+		"latest":      false,
+		"v1.2.3-":     false,
+	}
+	for tag, want := range tests {
+		if got := isSemver(tag); got != want {
+			t.Errorf("isSemver(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestSemverLessSort(t *testing.T) {
+	versions := []string{"v1.10.0", "v1.2.0", "v2.0.0", "v1.2.0-rc.1", "v0.1.0"}
+	sort.Slice(versions, func(i, j int) bool { return semverLess(versions[i], versions[j]) })
+
+	want := []string{"v0.1.0", "v1.2.0-rc.1", "v1.2.0", "v1.10.0", "v2.0.0"}
+	if len(versions) != len(want) {
+		t.Fatalf("got %v, want %v", versions, want)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Errorf("sorted[%d] = %q, want %q (full: %v)", i, versions[i], want[i], versions)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	if got := latestVersion(nil); got != "" {
+		t.Errorf("latestVersion(nil) = %q, want empty", got)
+	}
+	if got := latestVersion([]string{"v1.0.0", "v1.2.0"}); got != "v1.2.0" {
+		t.Errorf("latestVersion(...) = %q, want v1.2.0", got)
+	}
+}
+
+func TestRevForVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.2.3", "v1.2.3"},
+		{"v0.0.0-20210101000000-abcdefabcdef", "abcdefabcdef"},
+		{"v0.0.0-20210101000000-abcdefabcdef+incompatible", "v0.0.0-20210101000000-abcdefabcdef+incompatible"},
+	}
+	for _, tt := range tests {
+		if got := revForVersion(tt.version); got != tt.want {
+			t.Errorf("revForVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRepoCacheStoreVersionsEvictsOldest(t *testing.T) {
+	rc := newRepoCache(t.TempDir())
+	base := time.Now()
+
+	for i := 0; i < maxCachedRepos+1; i++ {
+		repo := "https://example.com/repo" + string(rune('a'+i%26)) + string(rune(i))
+		rc.storeVersions(repo, &cachedVersions{fetchedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.versions) != maxCachedRepos {
+		t.Errorf("len(rc.versions) = %d, want %d", len(rc.versions), maxCachedRepos)
+	}
+	if _, ok := rc.versions["https://example.com/repoa"+string(rune(0))]; ok {
+		t.Error("oldest entry (i=0) still cached, want it evicted")
+	}
+}
+
+// initGitRepo creates a repo under t.TempDir() with one commit and tag
+// v1.0.0, for tests that need a real git history without network access.
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "test@example.com")
+	run("config", "user.name", "test")
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+	run("tag", "v1.0.0")
+	return dir
+}
+
+func TestServeProxyRejectsUnknownVersion(t *testing.T) {
+	repo := initGitRepo(t)
+	h := &Handler{repoCache: newRepoCache(t.TempDir()), proxyFetchInterval: 3600}
+	pc := &pathConfig{path: "/foo", repo: repo, vcs: "git"}
+
+	for _, subpath := range []string{"@v/v1.0.0.info", "@v/v1.0.0.mod", "@v/v1.0.0.zip"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/foo/"+subpath, nil)
+		if !h.serveProxy(w, r, pc, subpath) {
+			t.Fatalf("serveProxy(%q) = false, want true", subpath)
+		}
+		if w.Code != 200 {
+			t.Errorf("serveProxy(%q) = %d, want 200: %s", subpath, w.Code, w.Body)
+		}
+	}
+
+	for _, subpath := range []string{"@v/v9.9.9-does-not-exist.info", "@v/v9.9.9-does-not-exist.mod", "@v/v9.9.9-does-not-exist.zip"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/foo/"+subpath, nil)
+		if !h.serveProxy(w, r, pc, subpath) {
+			t.Fatalf("serveProxy(%q) = false, want true", subpath)
+		}
+		if w.Code != http.StatusNotFound {
+			t.Errorf("serveProxy(%q) = %d, want 404: %s", subpath, w.Code, w.Body)
+		}
+	}
+}
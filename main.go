@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.bourbon.stream/go-vanityurls-apex/handler"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -13,12 +18,40 @@ import (
 func main() {
 	addr := ":" + os.Getenv("PORT")
 
-	h, err := handler.NewHandler(fileFetcher{path: "vanity.yaml"})
+	reg := prometheus.NewRegistry()
+	h, err := handler.NewHandler(fileFetcher{path: "vanity.yaml"}, handler.WithMetrics(reg))
 	if err != nil {
 		log.Fatal(err)
 	}
-	http.Handle("/", h)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if err := h.Reload(context.Background()); err != nil {
+				log.Println("reload on SIGHUP:", err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := h.Reload(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/-/healthz", h.Healthz)
+	mux.HandleFunc("/-/ready", h.Ready)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle("/", h)
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
 		log.Fatal(err)
 	}
 }